@@ -0,0 +1,69 @@
+package main
+
+import "testing"
+
+func TestLivePRRefsProtectsPRTag(t *testing.T) {
+	live := newLivePRRefs()
+	live.add(1, "", "")
+
+	tests := []struct {
+		version string
+		want    bool
+	}{
+		{"pr-1", true},
+		{"myapp-pr-1-abcdef1", true},
+		{"myapp-pr-11-abcdef1", false},
+		{"myapp-pr-123-abcdef1", false},
+		{"pr-2", false},
+	}
+	for _, tt := range tests {
+		if got := live.protects(tt.version); got != tt.want {
+			t.Errorf("protects(%q) = %v, want %v", tt.version, got, tt.want)
+		}
+	}
+}
+
+func TestLivePRRefsProtectsShortSHA(t *testing.T) {
+	live := newLivePRRefs()
+	live.add(7, "abcdef1234567890", "")
+
+	if !live.protects("myimage-abcdef1-latest") {
+		t.Error(`protects("myimage-abcdef1-latest") = false, want true`)
+	}
+	if live.protects("myimage-deadbee-latest") {
+		t.Error(`protects("myimage-deadbee-latest") = true, want false`)
+	}
+}
+
+func TestLivePRRefsProtectsBranchSlug(t *testing.T) {
+	live := newLivePRRefs()
+	live.add(9, "", "feature/Foo_Bar")
+
+	if !live.protects("myimage-feature-foo-bar") {
+		t.Error(`protects("myimage-feature-foo-bar") = false, want true`)
+	}
+	if live.protects("myimage-unrelated-branch") {
+		t.Error(`protects("myimage-unrelated-branch") = true, want false`)
+	}
+}
+
+func TestLivePRRefsProtectsNilIsInert(t *testing.T) {
+	var live *livePRRefs
+	if live.protects("pr-1") {
+		t.Error("nil *livePRRefs protects a version, want it to protect nothing")
+	}
+}
+
+func TestSlugifyRef(t *testing.T) {
+	tests := map[string]string{
+		"feature/Foo_Bar": "feature-foo-bar",
+		"main":            "main",
+		"---":             "",
+		"Release/1.2.3":   "release-1-2-3",
+	}
+	for ref, want := range tests {
+		if got := slugifyRef(ref); got != want {
+			t.Errorf("slugifyRef(%q) = %q, want %q", ref, got, want)
+		}
+	}
+}
@@ -2,35 +2,56 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"flag"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"regexp"
+	"runtime"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/percona-platform/get-stale-packages-action/pkg/ghtransport"
+	"github.com/percona-platform/get-stale-packages-action/pkg/packages"
+	"github.com/percona-platform/get-stale-packages-action/pkg/retention"
+	"github.com/percona-platform/get-stale-packages-action/pkg/semver"
 	"github.com/sethvargo/go-githubactions"
 	"github.com/shurcooL/githubv4"
 	"golang.org/x/oauth2"
 )
 
-const (
-	packageTTL = 7 * 24 * time.Hour
-
-	// https://semver.org/#is-there-a-suggested-regular-expression-regex-to-check-a-semver-string
-	semverRegExp = "^(?P<major>0|[1-9]\\d*)\\.(?P<minor>0|[1-9]\\d*)\\.(?P<patch>0|[1-9]\\d*)(?:-(?P<prerelease>" +
-		"(?:0|[1-9]\\d*|\\d*[a-zA-Z-][0-9a-zA-Z-]*)(?:\\.(?:0|[1-9]\\d*|\\d*[a-zA-Z-][0-9a-zA-Z-]*))*))?(?:\\+" +
-		"(?P<buildmetadata>[0-9a-zA-Z-]+(?:\\.[0-9a-zA-Z-]+)*))?$"
-)
-
-var reg = regexp.MustCompile(semverRegExp)
+// versionRecord carries everything needed to report and, if requested,
+// delete a single package version found while scanning.
+type versionRecord struct {
+	NodeID      string
+	PackageType packages.Type
+	PackageName string
+	DatabaseID  int64
+	Tag         string
+	UpdatedAt   time.Time
+}
 
-// That program collects repository packages that older than packageTTL and hasn't semver or 'latest' tag.
-// I.e. it returns comma separated list of packages created by pull requests.
+// That program collects repository (or, with GITHUB_OWNER set, organization-wide)
+// package versions that the retention policy in .github/stale-packages.yml
+// considers stale. By default it runs in dry-run mode and only reports them
+// via STALE_VERSIONS; with -delete it also removes them through the REST
+// Packages API. With -report it also writes a JSON record of every inspected
+// version, not just the stale ones, and when running under Actions it posts
+// a Markdown summary of the scan to the job's step summary.
 func main() {
 	log.SetFlags(0)
 	log.SetPrefix("get-stale-packages: ")
+
+	del := flag.Bool("delete", false, "delete stale versions instead of only reporting them")
+	maxDeletes := flag.Int("max-deletes", 0, "maximum number of versions to delete in one run (0 = no limit)")
+	ownerIsOrg := flag.Bool("org", false, "the scanned owner (GITHUB_OWNER, or the GITHUB_REPOSITORY owner) is an organization")
+	concurrency := flag.Int("concurrency", runtime.NumCPU(), "number of packages to scan in parallel")
+	keepPerMajor := flag.Int("keep-per-major", 0, "within each package, keep the N highest semver releases per major version and let older ones expire normally (0 = no per-major limit)")
+	reportPath := flag.String("report", "", "write a JSON report of every inspected version (package, version ID, tag, updated-at, classification and matched rule) to this path")
 	flag.Parse()
 
 	token := os.Getenv("ROBOT_TOKEN")
@@ -38,146 +59,799 @@ func main() {
 		githubactions.Fatalf("Environment variable ROBOT_TOKEN is empty.")
 	}
 
-	githubRepo := os.Getenv("GITHUB_REPOSITORY")
-	if githubRepo == "" {
-		githubactions.Fatalf("Environment variable GITHUB_REPOSITORY is empty.")
+	cfg, err := retention.Load(retention.ConfigPath)
+	if err != nil {
+		githubactions.Fatalf("failed to load retention policy: %s", err)
+	}
+
+	client := getClient(token)
+	ctx := context.Background()
+
+	var records []versionRecord
+	var report []reportEntry
+	if githubOwner := os.Getenv("GITHUB_OWNER"); githubOwner != "" {
+		records, report = scanOrganization(ctx, client, githubOwner, cfg, *concurrency, *keepPerMajor)
+	} else {
+		githubRepo := os.Getenv("GITHUB_REPOSITORY")
+		if githubRepo == "" {
+			githubactions.Fatalf("Environment variable GITHUB_REPOSITORY is empty.")
+		}
+		githubRepoSlice := strings.Split(githubRepo, "/")
+		records, report = scanRepository(ctx, client, githubRepoSlice[0], githubRepoSlice[1], cfg, *concurrency, *keepPerMajor)
+	}
+
+	var versions []string
+	for _, rec := range records {
+		versions = append(versions, rec.NodeID)
 	}
 
-	githubRepoSlice := strings.Split(githubRepo, "/")
-	repositoryOwner := githubRepoSlice[0]
-	repositoryName := githubRepoSlice[1]
+	if *del {
+		owner := os.Getenv("GITHUB_OWNER")
+		if owner == "" {
+			owner = strings.Split(os.Getenv("GITHUB_REPOSITORY"), "/")[0]
+		}
+		deleteVersions(ctx, packages.NewClient(&http.Client{Transport: tokenTransport(token)}, owner, *ownerIsOrg), records, *maxDeletes)
+	}
 
+	if *reportPath != "" {
+		writeReport(*reportPath, report)
+	}
+	if os.Getenv("GITHUB_STEP_SUMMARY") != "" {
+		writeJobSummary(report)
+	}
+
+	staleVersions := strings.Join(versions, ", ")
+	log.Printf("Setting STALE_VERSIONS to %q.", staleVersions)
+	githubactions.SetEnv("STALE_VERSIONS", staleVersions)
+}
+
+// scanRepository walks the packages of a single repository via the GraphQL API.
+func scanRepository(ctx context.Context, client *githubv4.Client, owner, name string, cfg *retention.Config, concurrency, keepPerMajor int) ([]versionRecord, []reportEntry) {
+	live := fetchLivePRRefs(ctx, client, owner, name)
+	pkgs := listRepositoryPackages(ctx, client, owner, name)
+
+	fetchMore := func(ctx context.Context, pkgName string, cursor githubv4.String) []versionNode {
+		return fetchRepositoryPackageVersions(ctx, client, owner, name, pkgName, cursor)
+	}
+	return scanPackages(ctx, pkgs, concurrency, fetchMore, live, cfg, keepPerMajor)
+}
+
+// listRepositoryPackages returns every package of a repository, each with its
+// first page of versions already attached.
+func listRepositoryPackages(ctx context.Context, client *githubv4.Client, owner, name string) []packageNode {
 	var query struct {
 		Repository struct {
 			Packages struct {
-				Nodes []struct {
-					ID       githubv4.ID
-					Name     githubv4.String
-					Versions struct {
-						Nodes []struct {
-							ID      githubv4.ID
-							Version githubv4.String
-							Files   struct {
-								Nodes []struct {
-									UpdatedAt githubv4.DateTime
-								}
-							} `graphql:"files(last: 1)"`
-						}
-						PageInfo PageInfo
-					} `graphql:"versions(last: 100, after: $versionsCursor)"`
-				}
+				Nodes    []packageNode
 				PageInfo PageInfo
-			} `graphql:"packages(last: 1, after: $packagesCursor)"`
+			} `graphql:"packages(first: 100, after: $packagesCursor)"`
 		} `graphql:"repository(owner: $repositoryOwner, name: $repositoryName)"`
 	}
 
 	variables := map[string]interface{}{
-		"repositoryOwner": githubv4.String(repositoryOwner),
-		"repositoryName":  githubv4.String(repositoryName),
+		"repositoryOwner": githubv4.String(owner),
+		"repositoryName":  githubv4.String(name),
 		"packagesCursor":  (*githubv4.String)(nil),
 		"versionsCursor":  (*githubv4.String)(nil),
 	}
 
-	client := getClient(token)
+	var pkgs []packageNode
+	for {
+		if err := client.Query(ctx, &query, variables); err != nil {
+			githubactions.Fatalf("failed to list packages: %s", err)
+		}
+		pkgs = append(pkgs, query.Repository.Packages.Nodes...)
 
-	var versions []string
+		if !query.Repository.Packages.PageInfo.HasNextPage {
+			break
+		}
+		variables["packagesCursor"] = githubv4.NewString(query.Repository.Packages.PageInfo.EndCursor)
+	}
+	return pkgs
+}
 
-	// loop packages one by one
+// fetchRepositoryPackageVersions returns the versions of pkgName that come
+// after cursor, i.e. everything beyond the first page listRepositoryPackages
+// already fetched.
+func fetchRepositoryPackageVersions(ctx context.Context, client *githubv4.Client, owner, name, pkgName string, cursor githubv4.String) []versionNode {
+	var query struct {
+		Repository struct {
+			Packages struct {
+				Nodes []struct {
+					Versions struct {
+						Nodes    []versionNode
+						PageInfo PageInfo
+					} `graphql:"versions(first: 100, after: $versionsCursor)"`
+				}
+			} `graphql:"packages(first: 1, names: $names)"`
+		} `graphql:"repository(owner: $repositoryOwner, name: $repositoryName)"`
+	}
+
+	variables := map[string]interface{}{
+		"repositoryOwner": githubv4.String(owner),
+		"repositoryName":  githubv4.String(name),
+		"names":           []githubv4.String{githubv4.String(pkgName)},
+		"versionsCursor":  githubv4.NewString(cursor),
+	}
+
+	var versions []versionNode
 	for {
-		// loop versions pages
-		for {
-			err := client.Query(context.Background(), &query, variables)
-			if err != nil {
-				githubactions.Fatalf("failed to query packages: %s", err)
-			}
+		if err := client.Query(ctx, &query, variables); err != nil {
+			githubactions.Fatalf("failed to list versions of %s: %s", pkgName, err)
+		}
+		if len(query.Repository.Packages.Nodes) == 0 {
+			break
+		}
 
-			if len(query.Repository.Packages.Nodes) == 0 {
-				break
-			}
+		page := query.Repository.Packages.Nodes[0].Versions
+		versions = append(versions, page.Nodes...)
+
+		if !page.PageInfo.HasNextPage {
+			break
+		}
+		variables["versionsCursor"] = githubv4.NewString(page.PageInfo.EndCursor)
+	}
+	return versions
+}
+
+// scanPackages fans pkgs out across a bounded pool of concurrency workers.
+// Each worker finishes paginating one package's versions and funnels the
+// result back through a channel; inspectPackage then runs on the main
+// goroutine as results arrive.
+func scanPackages(
+	ctx context.Context,
+	pkgs []packageNode,
+	concurrency int,
+	fetchMore func(ctx context.Context, pkgName string, cursor githubv4.String) []versionNode,
+	live *livePRRefs,
+	cfg *retention.Config,
+	keepPerMajor int,
+) ([]versionRecord, []reportEntry) {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	type packageVersions struct {
+		pkg      packageNode
+		versions []versionNode
+	}
 
-			pkg := query.Repository.Packages.Nodes[0]
-			log.Printf("Inspecting package %v %s.", pkg.ID, pkg.Name)
+	jobs := make(chan packageNode)
+	results := make(chan packageVersions)
 
-			// loop versions
-			for _, node := range pkg.Versions.Nodes {
-				if len(node.Files.Nodes) == 0 {
-					log.Printf("No files in %v %s.", node.ID, node.Version)
-					continue
+	var workers sync.WaitGroup
+	workers.Add(concurrency)
+	for i := 0; i < concurrency; i++ {
+		go func() {
+			defer workers.Done()
+			for pkg := range jobs {
+				versions := append([]versionNode(nil), pkg.Versions.Nodes...)
+				if pkg.Versions.PageInfo.HasNextPage {
+					versions = append(versions, fetchMore(ctx, string(pkg.Name), pkg.Versions.PageInfo.EndCursor)...)
 				}
+				results <- packageVersions{pkg: pkg, versions: versions}
+			}
+		}()
+	}
+
+	go func() {
+		for _, pkg := range pkgs {
+			jobs <- pkg
+		}
+		close(jobs)
+	}()
+	go func() {
+		workers.Wait()
+		close(results)
+	}()
+
+	var records []versionRecord
+	var report []reportEntry
+	for pv := range results {
+		recs, entries := inspectPackage(pv.pkg, pv.versions, live, cfg, keepPerMajor)
+		records = append(records, recs...)
+		report = append(report, entries...)
+	}
+	return records, report
+}
 
-				updatedAt := node.Files.Nodes[0].UpdatedAt
-				var stale bool
-				if matchVersion(node.Version) {
-					// check date on files that match current version
-					if updatedAt.Before(time.Now().Add(-packageTTL)) {
-						stale = true
-						versions = append(versions, node.ID.(string))
-					}
+// fetchLivePRRefs collects the head SHA, PR number and head branch of every
+// open pull request in owner/name, so that inspectPackage can avoid deleting
+// a version a long-running review still depends on.
+func fetchLivePRRefs(ctx context.Context, client *githubv4.Client, owner, name string) *livePRRefs {
+	var query struct {
+		Repository struct {
+			PullRequests struct {
+				Nodes []struct {
+					Number      githubv4.Int
+					HeadRefName githubv4.String
+					HeadRefOid  githubv4.String
 				}
+				PageInfo PageInfo
+			} `graphql:"pullRequests(states: OPEN, first: 100, after: $pullRequestsCursor)"`
+		} `graphql:"repository(owner: $repositoryOwner, name: $repositoryName)"`
+	}
+
+	variables := map[string]interface{}{
+		"repositoryOwner":    githubv4.String(owner),
+		"repositoryName":     githubv4.String(name),
+		"pullRequestsCursor": (*githubv4.String)(nil),
+	}
+
+	live := newLivePRRefs()
+	for {
+		if err := client.Query(ctx, &query, variables); err != nil {
+			githubactions.Fatalf("failed to query open pull requests: %s", err)
+		}
+
+		for _, pr := range query.Repository.PullRequests.Nodes {
+			live.add(int(pr.Number), string(pr.HeadRefOid), string(pr.HeadRefName))
+		}
+
+		if !query.Repository.PullRequests.PageInfo.HasNextPage {
+			break
+		}
+		variables["pullRequestsCursor"] = githubv4.NewString(query.Repository.PullRequests.PageInfo.EndCursor)
+	}
+	return live
+}
+
+// scanOrganization walks every package owned by an organization via the GraphQL API.
+func scanOrganization(ctx context.Context, client *githubv4.Client, owner string, cfg *retention.Config, concurrency, keepPerMajor int) ([]versionRecord, []reportEntry) {
+	pkgs := listOrganizationPackages(ctx, client, owner)
+
+	fetchMore := func(ctx context.Context, pkgName string, cursor githubv4.String) []versionNode {
+		return fetchOrganizationPackageVersions(ctx, client, owner, pkgName, cursor)
+	}
+	// Pull requests belong to a repository, not an organization, so an
+	// org-wide scan has no live refs to protect against.
+	return scanPackages(ctx, pkgs, concurrency, fetchMore, nil, cfg, keepPerMajor)
+}
+
+// listOrganizationPackages returns every package owned by an organization,
+// each with its first page of versions already attached.
+func listOrganizationPackages(ctx context.Context, client *githubv4.Client, owner string) []packageNode {
+	var query struct {
+		Organization struct {
+			Packages struct {
+				Nodes    []packageNode
+				PageInfo PageInfo
+			} `graphql:"packages(first: 100, after: $packagesCursor)"`
+		} `graphql:"organization(login: $owner)"`
+	}
+
+	variables := map[string]interface{}{
+		"owner":          githubv4.String(owner),
+		"packagesCursor": (*githubv4.String)(nil),
+		"versionsCursor": (*githubv4.String)(nil),
+	}
 
-				if stale {
-					log.Printf("Stale version: %v (%q, %s)", node.ID, node.Version, updatedAt)
-				} else {
-					log.Printf("Skip version : %v (%q, %s)", node.ID, node.Version, updatedAt)
+	var pkgs []packageNode
+	for {
+		if err := client.Query(ctx, &query, variables); err != nil {
+			githubactions.Fatalf("failed to list packages: %s", err)
+		}
+		pkgs = append(pkgs, query.Organization.Packages.Nodes...)
+
+		if !query.Organization.Packages.PageInfo.HasNextPage {
+			break
+		}
+		variables["packagesCursor"] = githubv4.NewString(query.Organization.Packages.PageInfo.EndCursor)
+	}
+	return pkgs
+}
+
+// fetchOrganizationPackageVersions returns the versions of pkgName that come
+// after cursor, i.e. everything beyond the first page listOrganizationPackages
+// already fetched.
+func fetchOrganizationPackageVersions(ctx context.Context, client *githubv4.Client, owner, pkgName string, cursor githubv4.String) []versionNode {
+	var query struct {
+		Organization struct {
+			Packages struct {
+				Nodes []struct {
+					Versions struct {
+						Nodes    []versionNode
+						PageInfo PageInfo
+					} `graphql:"versions(first: 100, after: $versionsCursor)"`
 				}
-			}
+			} `graphql:"packages(first: 1, names: $names)"`
+		} `graphql:"organization(login: $owner)"`
+	}
 
-			if !pkg.Versions.PageInfo.HasNextPage {
-				break
-			}
-			variables["versionsCursor"] = githubv4.NewString(pkg.Versions.PageInfo.EndCursor)
+	variables := map[string]interface{}{
+		"owner":          githubv4.String(owner),
+		"names":          []githubv4.String{githubv4.String(pkgName)},
+		"versionsCursor": githubv4.NewString(cursor),
+	}
+
+	var versions []versionNode
+	for {
+		if err := client.Query(ctx, &query, variables); err != nil {
+			githubactions.Fatalf("failed to list versions of %s: %s", pkgName, err)
+		}
+		if len(query.Organization.Packages.Nodes) == 0 {
+			break
 		}
 
-		if !query.Repository.Packages.PageInfo.HasNextPage {
+		page := query.Organization.Packages.Nodes[0].Versions
+		versions = append(versions, page.Nodes...)
+
+		if !page.PageInfo.HasNextPage {
 			break
 		}
-		variables["packagesCursor"] = githubv4.NewString(query.Repository.Packages.PageInfo.EndCursor)
+		variables["versionsCursor"] = githubv4.NewString(page.PageInfo.EndCursor)
 	}
+	return versions
+}
 
-	staleVersions := strings.Join(versions, ", ")
-	log.Printf("Setting STALE_VERSIONS to %q.", staleVersions)
-	githubactions.SetEnv("STALE_VERSIONS", staleVersions)
+// packageNode is the shape of a single package as fetched from the GraphQL API.
+type packageNode struct {
+	ID          githubv4.ID
+	Name        githubv4.String
+	PackageType githubv4.String
+	Versions    struct {
+		Nodes    []versionNode
+		PageInfo PageInfo
+	} `graphql:"versions(first: 100, after: $versionsCursor)"`
 }
 
-// getClient returns Github API client with packages preview enabled.
-func getClient(token string) *githubv4.Client {
-	return githubv4.NewClient(
-		&http.Client{
-			Transport: &oauth2.Transport{
-				Base:   &PackagePreview{T: http.DefaultTransport},
-				Source: oauth2.ReuseTokenSource(nil, oauth2.StaticTokenSource(&oauth2.Token{AccessToken: token})),
-			},
+// versionNode is the shape of a single package version as fetched from the GraphQL API.
+type versionNode struct {
+	ID         githubv4.ID
+	DatabaseID githubv4.Int `graphql:"databaseId"`
+	Version    githubv4.String
+	Files      struct {
+		Nodes []struct {
+			UpdatedAt githubv4.DateTime
+			Size      githubv4.Int
+		}
+	} `graphql:"files(last: 1)"`
+}
+
+// updatedAt is the last-modified time of node's sole file, or the zero time
+// if it has none.
+func (node versionNode) updatedAt() time.Time {
+	if len(node.Files.Nodes) == 0 {
+		return time.Time{}
+	}
+	return node.Files.Nodes[0].UpdatedAt.Time
+}
+
+// size is the size in bytes of node's sole file, or 0 if it has none.
+func (node versionNode) size() int64 {
+	if len(node.Files.Nodes) == 0 {
+		return 0
+	}
+	return int64(node.Files.Nodes[0].Size)
+}
+
+// inspectPackage logs every version of pkg and returns the ones the
+// retention policy in cfg considers stale, alongside a reportEntry for every
+// version inspected (stale, protected or skipped alike), for the -report
+// and step summary output. versions is sorted most recently updated first
+// so that cfg's keep_last can protect the newest N of them.
+func inspectPackage(pkg packageNode, versions []versionNode, live *livePRRefs, cfg *retention.Config, keepPerMajor int) ([]versionRecord, []reportEntry) {
+	log.Printf("Inspecting package %v %s.", pkg.ID, pkg.Name)
+
+	rule := cfg.RuleFor(string(pkg.Name))
+	if rule == nil {
+		log.Printf("No retention rule matches package %s; leaving its versions untouched.", pkg.Name)
+
+		var report []reportEntry
+		for _, node := range versions {
+			report = append(report, reportEntry{
+				PackageName:    string(pkg.Name),
+				VersionID:      node.ID.(string),
+				Tag:            string(node.Version),
+				UpdatedAt:      node.updatedAt(),
+				SizeBytes:      node.size(),
+				Classification: "skipped",
+			})
+		}
+		return nil, report
+	}
+
+	sort.Slice(versions, func(i, j int) bool {
+		return versions[i].updatedAt().After(versions[j].updatedAt())
+	})
+
+	semverState := computeSemverState(versions, keepPerMajor)
+
+	var records []versionRecord
+	var report []reportEntry
+	for i, node := range versions {
+		if len(node.Files.Nodes) == 0 {
+			log.Printf("No files in %v %s.", node.ID, node.Version)
+			report = append(report, reportEntry{
+				PackageName:    string(pkg.Name),
+				VersionID:      node.ID.(string),
+				Tag:            string(node.Version),
+				Classification: "skipped",
+				Rule:           rule.Rule.Packages,
+			})
+			continue
+		}
+
+		updatedAt := node.updatedAt()
+		keptByRecency := i < rule.KeepLast()
+
+		entry := reportEntry{
+			PackageName: string(pkg.Name),
+			VersionID:   node.ID.(string),
+			Tag:         string(node.Version),
+			UpdatedAt:   updatedAt,
+			SizeBytes:   node.size(),
+			Rule:        rule.Rule.Packages,
+		}
+
+		switch classifyVersion(string(node.Version), live, rule, keptByRecency, semverState) {
+		case Protected:
+			log.Printf("Protected version: %v (%q, %s)", node.ID, node.Version, updatedAt)
+			entry.Classification = "protected"
+			report = append(report, entry)
+			continue
+		case Skip:
+			log.Printf("Skip version : %v (%q, %s)", node.ID, node.Version, updatedAt)
+			entry.Classification = "skipped"
+			report = append(report, entry)
+			continue
+		}
+
+		// Candidate for staleness: only versions old enough to have outlived the rule's TTL are reported.
+		if !updatedAt.Before(time.Now().Add(-rule.TTL())) {
+			log.Printf("Skip version : %v (%q, %s)", node.ID, node.Version, updatedAt)
+			entry.Classification = "skipped"
+			report = append(report, entry)
+			continue
+		}
+
+		records = append(records, versionRecord{
+			NodeID:      node.ID.(string),
+			PackageType: restPackageType(pkg.PackageType),
+			PackageName: string(pkg.Name),
+			DatabaseID:  int64(node.DatabaseID),
+			Tag:         string(node.Version),
+			UpdatedAt:   updatedAt,
 		})
+		entry.Classification = "stale"
+		report = append(report, entry)
+		log.Printf("Stale version: %v (%q, %s)", node.ID, node.Version, updatedAt)
+	}
+	return records, report
 }
 
-// matchVersion returns true if version doesn't match semver, 'latest' or other protected versions.
-func matchVersion(version githubv4.String) bool {
-	// version tags
-	if reg.MatchString(string(version)) {
-		return false
+// reportEntry is one record of the -report JSON output and the step summary
+// table: the classification reached for a single inspected package version,
+// not just the ones found stale, so a reviewer can audit what the retention
+// policy decided and why.
+type reportEntry struct {
+	PackageName    string    `json:"package"`
+	VersionID      string    `json:"version_id"`
+	Tag            string    `json:"tag"`
+	UpdatedAt      time.Time `json:"updated_at"`
+	SizeBytes      int64     `json:"size_bytes"`
+	Classification string    `json:"classification"`
+	Rule           string    `json:"rule"`
+}
+
+// Classification is the verdict a VersionClassifier reaches for a single
+// package version tag.
+type Classification int
+
+const (
+	// Stale means the tag is a candidate for TTL-based expiry.
+	Stale Classification = iota
+	// Protected means the tag must never be deleted, regardless of age.
+	Protected
+	// Skip means the tag is neither stale nor protected; it's simply ignored.
+	Skip
+)
+
+// VersionClassifier decides what to do with a single package version's tag,
+// given the set of refs still referenced by open pull requests, the
+// retention rule that applies to its package, whether it's among the rule's
+// keep_last most recently updated versions, and its package's semverState.
+type VersionClassifier func(version string, live *livePRRefs, rule *retention.CompiledRule, keptByRecency bool, sv semverState) Classification
+
+// classifyVersion is the VersionClassifier used by inspectPackage.
+//
+// A version is Protected when it's referenced by an open pull request. It's
+// Skip when its tag matches the rule's protect_tags — an operator's explicit
+// pin always wins, checked before any automatic heuristic gets a say, so a
+// pinned legacy release or prerelease isn't silently overridden by
+// -keep-per-major or the prerelease-expiry rule below. Otherwise it's Stale
+// when it's a semver prerelease (e.g. "1.2.3-rc.1") whose stable release
+// ("1.2.3") already exists. Otherwise, when -keep-per-major is set, a semver
+// tag is Protected if it's among the N highest releases of its major
+// version and Stale if it isn't. Otherwise it's
+// Protected when it's among the rule's keep_last most recent versions and
+// its tag isn't forced through by delete_tags. Anything left is Stale, a
+// candidate for TTL expiry.
+func classifyVersion(version string, live *livePRRefs, rule *retention.CompiledRule, keptByRecency bool, sv semverState) Classification {
+	if live.protects(version) {
+		return Protected
+	}
+	if rule.Protects(version) {
+		return Skip
 	}
 
-	// Github internal meta tag https://github.community/t5/GitHub-Actions/GitHub-Package-Registry-tag-docker-base-layer-is-missing-a/m-p/46119
-	if version == "docker-base-layer" {
-		return false
+	if parsed, ok := semver.Parse(version); ok {
+		if parsed.IsPrerelease() && sv.hasStableRelease(parsed) {
+			return Stale
+		}
+		if sv.keepPerMajor > 0 {
+			if sv.kept[version] {
+				return Protected
+			}
+			return Stale
+		}
+	}
+
+	if keptByRecency && !rule.ForcesDelete(version) {
+		return Protected
+	}
+
+	return Stale
+}
+
+// semverState is the per-package context classifyVersion needs to apply
+// -keep-per-major: which tags rank among the N highest per major version,
+// and which major.minor.patch cores have a stable release present.
+type semverState struct {
+	keepPerMajor int
+	kept         map[string]bool
+	stableCores  map[string]bool
+}
+
+// hasStableRelease reports whether a stable release exists for sv's
+// major.minor.patch core, which expires sv if it's a prerelease.
+func (s semverState) hasStableRelease(sv semver.SemVer) bool {
+	return s.stableCores[sv.Core()]
+}
+
+// computeSemverState parses every version's tag as semver and, if
+// keepPerMajor > 0, ranks each major version's releases by precedence to
+// determine the top keepPerMajor of them.
+func computeSemverState(versions []versionNode, keepPerMajor int) semverState {
+	type parsedVersion struct {
+		tag string
+		sv  semver.SemVer
 	}
 
-	// special tag for latest version
-	if version == "latest" {
+	byMajor := map[int][]parsedVersion{}
+	stableCores := map[string]bool{}
+	for _, node := range versions {
+		sv, ok := semver.Parse(string(node.Version))
+		if !ok {
+			continue
+		}
+		if !sv.IsPrerelease() {
+			stableCores[sv.Core()] = true
+		}
+		byMajor[sv.Major] = append(byMajor[sv.Major], parsedVersion{tag: string(node.Version), sv: sv})
+	}
+
+	kept := map[string]bool{}
+	if keepPerMajor > 0 {
+		for _, group := range byMajor {
+			sort.Slice(group, func(i, j int) bool {
+				return group[j].sv.Less(group[i].sv) // descending precedence
+			})
+			for _, pv := range group[:min(keepPerMajor, len(group))] {
+				kept[pv.tag] = true
+			}
+		}
+	}
+
+	return semverState{keepPerMajor: keepPerMajor, kept: kept, stableCores: stableCores}
+}
+
+// livePRRefs is the set of refs that open pull requests in a repository
+// currently point at: short commit SHAs, "pr-<number>" tags, and slugified
+// head branch names. A version tag that embeds any of them is still in use
+// by a review in progress and must not be deleted.
+type livePRRefs struct {
+	shortSHAs map[string]struct{}
+	prTags    []*regexp.Regexp
+	branches  map[string]struct{}
+}
+
+func newLivePRRefs() *livePRRefs {
+	return &livePRRefs{
+		shortSHAs: map[string]struct{}{},
+		branches:  map[string]struct{}{},
+	}
+}
+
+// add records the refs of one open pull request.
+func (l *livePRRefs) add(number int, headSHA, headRefName string) {
+	const shortSHALen = 7
+	if len(headSHA) >= shortSHALen {
+		l.shortSHAs[strings.ToLower(headSHA[:shortSHALen])] = struct{}{}
+	}
+	// Requiring a non-digit (or end of string) after the number keeps PR #1
+	// from matching a tag embedding PR #11, #123, etc.
+	l.prTags = append(l.prTags, regexp.MustCompile(fmt.Sprintf(`pr-%d(\D|$)`, number)))
+	if slug := slugifyRef(headRefName); slug != "" {
+		l.branches[slug] = struct{}{}
+	}
+}
+
+// protects reports whether version embeds a ref from any open pull request.
+// A nil *livePRRefs (no repository context, e.g. an org-wide scan) protects
+// nothing.
+func (l *livePRRefs) protects(version string) bool {
+	if l == nil {
 		return false
 	}
 
-	return true
+	v := strings.ToLower(version)
+	for _, prTag := range l.prTags {
+		if prTag.MatchString(v) {
+			return true
+		}
+	}
+	for sha := range l.shortSHAs {
+		if strings.Contains(v, sha) {
+			return true
+		}
+	}
+	for branch := range l.branches {
+		if strings.Contains(v, branch) {
+			return true
+		}
+	}
+	return false
 }
 
-// PackagePreview enables packages github API.
-type PackagePreview struct {
-	T http.RoundTripper
+// slugifyRef lowercases ref and replaces every run of non alpha-numeric
+// characters with a single '-', dropping any leading or trailing '-' (so
+// "---" yields ""), mirroring how Docker tags are commonly
+// derived from branch names (e.g. "feature/Foo_Bar" -> "feature-foo-bar").
+func slugifyRef(ref string) string {
+	var b strings.Builder
+	lastDash := false
+	for _, r := range strings.ToLower(ref) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+			lastDash = false
+			continue
+		}
+		if !lastDash {
+			b.WriteByte('-')
+			lastDash = true
+		}
+	}
+	return strings.Trim(b.String(), "-")
+}
+
+// restPackageType maps a GraphQL PackageType enum value to the package_type
+// string accepted by the REST Packages API.
+func restPackageType(gqlType githubv4.String) packages.Type {
+	switch gqlType {
+	case "DOCKER":
+		return packages.TypeContainer
+	case "MAVEN":
+		return packages.TypeMaven
+	case "NPM":
+		return packages.TypeNpm
+	case "RUBYGEMS":
+		return packages.TypeRubygems
+	case "NUGET":
+		return packages.TypeNuget
+	default:
+		return packages.Type(strings.ToLower(string(gqlType)))
+	}
 }
 
-func (pp *PackagePreview) RoundTrip(req *http.Request) (*http.Response, error) {
-	req.Header.Add("Accept", "application/vnd.github.packages-preview+json")
-	return pp.T.RoundTrip(req)
+// deleteVersions deletes up to maxDeletes of the given records through the
+// REST Packages API, logging the outcome of each attempt. maxDeletes <= 0
+// means no limit.
+func deleteVersions(ctx context.Context, client *packages.Client, records []versionRecord, maxDeletes int) {
+	deleted := 0
+	for _, rec := range records {
+		if maxDeletes > 0 && deleted >= maxDeletes {
+			log.Printf("Reached max-deletes=%d, leaving %d more stale versions in place.", maxDeletes, len(records)-deleted)
+			return
+		}
+
+		err := client.DeleteVersion(ctx, rec.PackageType, rec.PackageName, rec.DatabaseID)
+		if err != nil {
+			log.Printf("delete result: package=%s type=%s version=%d tag=%q status=failed error=%q",
+				rec.PackageName, rec.PackageType, rec.DatabaseID, rec.Tag, err)
+			continue
+		}
+
+		deleted++
+		log.Printf("delete result: package=%s type=%s version=%d tag=%q status=deleted",
+			rec.PackageName, rec.PackageType, rec.DatabaseID, rec.Tag)
+	}
+}
+
+// writeReport marshals report as JSON to path, for -report=path.json.
+func writeReport(path string, report []reportEntry) {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		githubactions.Fatalf("failed to marshal report: %s", err)
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		githubactions.Fatalf("failed to write report to %s: %s", path, err)
+	}
+}
+
+// writeJobSummary renders report as a Markdown table of per-package
+// classification counts and bytes reclaimable, and posts it to the job's
+// step summary.
+func writeJobSummary(report []reportEntry) {
+	type packageTotals struct {
+		stale, protected, skipped int
+		reclaimableBytes          int64
+	}
+
+	totals := map[string]*packageTotals{}
+	var names []string
+	for _, entry := range report {
+		t, ok := totals[entry.PackageName]
+		if !ok {
+			t = &packageTotals{}
+			totals[entry.PackageName] = t
+			names = append(names, entry.PackageName)
+		}
+		switch entry.Classification {
+		case "stale":
+			t.stale++
+			t.reclaimableBytes += entry.SizeBytes
+		case "protected":
+			t.protected++
+		default:
+			t.skipped++
+		}
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	b.WriteString("## Stale packages\n\n")
+	b.WriteString("| Package | Stale | Protected | Skipped | Reclaimable |\n")
+	b.WriteString("|---|---|---|---|---|\n")
+
+	var totalReclaimable int64
+	for _, name := range names {
+		t := totals[name]
+		totalReclaimable += t.reclaimableBytes
+		fmt.Fprintf(&b, "| %s | %d | %d | %d | %s |\n", name, t.stale, t.protected, t.skipped, formatBytes(t.reclaimableBytes))
+	}
+	fmt.Fprintf(&b, "| **Total** | | | | **%s** |\n", formatBytes(totalReclaimable))
+
+	githubactions.AddStepSummary(b.String())
+}
+
+// formatBytes renders n as a human-readable byte size (e.g. "1.5 MiB").
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for v := n / unit; v >= unit; v /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// getClient returns a GitHub GraphQL API client authenticated with token.
+func getClient(token string) *githubv4.Client {
+	return githubv4.NewClient(&http.Client{Transport: tokenTransport(token)})
+}
+
+// tokenTransport returns an http.RoundTripper that authenticates every
+// request with token and retries transient failures, for use by both the
+// GraphQL and REST clients.
+func tokenTransport(token string) http.RoundTripper {
+	return &oauth2.Transport{
+		Base:   ghtransport.New(http.DefaultTransport),
+		Source: oauth2.ReuseTokenSource(nil, oauth2.StaticTokenSource(&oauth2.Token{AccessToken: token})),
+	}
 }
 
 type PageInfo struct {
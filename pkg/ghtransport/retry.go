@@ -0,0 +1,122 @@
+// Package ghtransport provides an http.RoundTripper that retries transient
+// GitHub API failures with exponential backoff and jitter, honoring
+// Retry-After and X-RateLimit-Remaining/X-RateLimit-Reset, similar in spirit
+// to hashicorp/go-retryablehttp.
+package ghtransport
+
+import (
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultMaxRetries = 5
+	defaultMinWait    = 1 * time.Second
+	defaultMaxWait    = 60 * time.Second
+)
+
+// RetryTransport wraps another http.RoundTripper, retrying requests that
+// fail with a network error, a server error or a 429. Retry-After and
+// X-RateLimit-Remaining/X-RateLimit-Reset only set how long it waits before
+// such a retry. It does not retry 404 or 422: those mean the resource is gone
+// or the request itself is invalid, and burning the retry budget on them
+// only slows down a scan that found a version deleted mid-run.
+type RetryTransport struct {
+	Base       http.RoundTripper
+	MaxRetries int
+	MinWait    time.Duration
+	MaxWait    time.Duration
+}
+
+// New returns a RetryTransport wrapping base with sensible defaults.
+func New(base http.RoundTripper) *RetryTransport {
+	return &RetryTransport{
+		Base:       base,
+		MaxRetries: defaultMaxRetries,
+		MinWait:    defaultMinWait,
+		MaxWait:    defaultMaxWait,
+	}
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *RetryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		attemptReq := req
+		if attempt > 0 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			clone := req.Clone(req.Context())
+			clone.Body = body
+			attemptReq = clone
+		}
+
+		resp, err := t.Base.RoundTrip(attemptReq)
+		if attempt >= t.MaxRetries || !shouldRetry(resp, err) {
+			return resp, err
+		}
+
+		wait := backoff(attempt, t.MinWait, t.MaxWait, resp)
+		if resp != nil {
+			_, _ = io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+
+		select {
+		case <-req.Context().Done():
+			return resp, req.Context().Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+// shouldRetry reports whether a request that produced resp, err should be retried.
+// A successful response is never retried, even one that happens to carry
+// X-RateLimit-Remaining: 0 — that header only controls how long a retry that's
+// already needed should wait, not whether one is needed. Retrying a
+// successful non-idempotent request (e.g. a DELETE) would otherwise resend it
+// and misreport its already-applied result as a failure.
+func shouldRetry(resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	switch resp.StatusCode {
+	case http.StatusNotFound, http.StatusUnprocessableEntity:
+		return false
+	case http.StatusTooManyRequests:
+		return true
+	}
+	return resp.StatusCode >= http.StatusInternalServerError
+}
+
+// backoff computes how long to wait before the next attempt, preferring
+// Retry-After or a rate-limit reset time reported by the server, and falling
+// back to exponential backoff with jitter otherwise.
+func backoff(attempt int, minWait, maxWait time.Duration, resp *http.Response) time.Duration {
+	if resp != nil {
+		if ra := resp.Header.Get("Retry-After"); ra != "" {
+			if secs, err := strconv.Atoi(ra); err == nil && secs >= 0 {
+				return time.Duration(secs) * time.Second
+			}
+		}
+		if resp.Header.Get("X-RateLimit-Remaining") == "0" {
+			if reset := resp.Header.Get("X-RateLimit-Reset"); reset != "" {
+				if ts, err := strconv.ParseInt(reset, 10, 64); err == nil {
+					if wait := time.Until(time.Unix(ts, 0)); wait > 0 {
+						return wait
+					}
+				}
+			}
+		}
+	}
+
+	wait := minWait << attempt
+	if wait <= 0 || wait > maxWait {
+		wait = maxWait
+	}
+	return wait/2 + time.Duration(rand.Int63n(int64(wait)/2+1))
+}
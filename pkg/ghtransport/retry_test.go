@@ -0,0 +1,69 @@
+package ghtransport
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestShouldRetry(t *testing.T) {
+	resp := func(status int, headers map[string]string) *http.Response {
+		h := make(http.Header)
+		for k, v := range headers {
+			h.Set(k, v)
+		}
+		return &http.Response{StatusCode: status, Header: h}
+	}
+
+	tests := []struct {
+		name string
+		resp *http.Response
+		err  error
+		want bool
+	}{
+		{"network error", nil, errors.New("boom"), true},
+		{"server error", resp(http.StatusInternalServerError, nil), nil, true},
+		{"too many requests", resp(http.StatusTooManyRequests, nil), nil, true},
+		{"not found", resp(http.StatusNotFound, nil), nil, false},
+		{"unprocessable entity", resp(http.StatusUnprocessableEntity, nil), nil, false},
+		{"success", resp(http.StatusOK, nil), nil, false},
+		{
+			"success with rate limit exhausted",
+			resp(http.StatusOK, map[string]string{"X-RateLimit-Remaining": "0"}),
+			nil,
+			false,
+		},
+		{
+			"no content with rate limit exhausted",
+			resp(http.StatusNoContent, map[string]string{"X-RateLimit-Remaining": "0"}),
+			nil,
+			false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := shouldRetry(tt.resp, tt.err); got != tt.want {
+				t.Errorf("shouldRetry() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBackoffPrefersRetryAfter(t *testing.T) {
+	h := make(http.Header)
+	h.Set("Retry-After", "2")
+	resp := &http.Response{StatusCode: http.StatusTooManyRequests, Header: h}
+
+	if got, want := backoff(0, time.Second, time.Minute, resp), 2*time.Second; got != want {
+		t.Errorf("backoff() = %s, want %s", got, want)
+	}
+}
+
+func TestBackoffExponentialFallback(t *testing.T) {
+	wait := backoff(3, time.Second, time.Minute, nil)
+	if wait <= 0 || wait > time.Minute {
+		t.Errorf("backoff() = %s, want a positive value capped at maxWait", wait)
+	}
+}
@@ -0,0 +1,81 @@
+// Package packages is a small client for the GitHub REST Packages API.
+//
+// It exists to replace the deprecated application/vnd.github.packages-preview+json
+// GraphQL schema, which GitHub has been winding down for container/registry
+// packages, for the one operation that schema can't do at all: deleting a
+// package version.
+package packages
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// Type is a GitHub package type, as accepted by the REST Packages API.
+type Type string
+
+// Package types supported by the GitHub Packages API.
+const (
+	TypeContainer Type = "container"
+	TypeMaven     Type = "maven"
+	TypeNpm       Type = "npm"
+	TypeRubygems  Type = "rubygems"
+	TypeNuget     Type = "nuget"
+)
+
+const apiBaseURL = "https://api.github.com"
+
+// Client talks to the GitHub REST Packages API on behalf of a single
+// organization or user account.
+type Client struct {
+	HTTPClient *http.Client
+	BaseURL    string
+
+	// Owner is the org or user login that owns the packages.
+	Owner string
+	// IsOrg selects the /orgs/{owner}/... routes instead of /users/{owner}/....
+	IsOrg bool
+}
+
+// NewClient returns a Client scoped to owner. isOrg must be true when owner
+// is an organization login and false when it's a user login.
+func NewClient(httpClient *http.Client, owner string, isOrg bool) *Client {
+	return &Client{
+		HTTPClient: httpClient,
+		BaseURL:    apiBaseURL,
+		Owner:      owner,
+		IsOrg:      isOrg,
+	}
+}
+
+func (c *Client) ownerPath() string {
+	if c.IsOrg {
+		return "orgs/" + c.Owner
+	}
+	return "users/" + c.Owner
+}
+
+// DeleteVersion deletes a single version of the named package.
+func (c *Client) DeleteVersion(ctx context.Context, packageType Type, packageName string, versionID int64) error {
+	u := fmt.Sprintf("%s/%s/packages/%s/%s/versions/%d",
+		c.BaseURL, c.ownerPath(), packageType, url.PathEscape(packageName), versionID)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, u, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent {
+		return fmt.Errorf("delete %s %s version %d: unexpected status %s", packageType, packageName, versionID, resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package packages
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientOwnerPath(t *testing.T) {
+	org := &Client{Owner: "percona-platform", IsOrg: true}
+	if got, want := org.ownerPath(), "orgs/percona-platform"; got != want {
+		t.Errorf("ownerPath() = %q, want %q", got, want)
+	}
+
+	user := &Client{Owner: "someuser", IsOrg: false}
+	if got, want := user.ownerPath(), "users/someuser"; got != want {
+		t.Errorf("ownerPath() = %q, want %q", got, want)
+	}
+}
+
+func TestDeleteVersion(t *testing.T) {
+	const wantPath = "/orgs/percona-platform/packages/container/my-pkg/versions/42"
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodDelete {
+			t.Errorf("method = %s, want DELETE", r.Method)
+		}
+		if r.URL.Path != wantPath {
+			t.Errorf("path = %s, want %s", r.URL.Path, wantPath)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	client := &Client{HTTPClient: srv.Client(), BaseURL: srv.URL, Owner: "percona-platform", IsOrg: true}
+	if err := client.DeleteVersion(context.Background(), TypeContainer, "my-pkg", 42); err != nil {
+		t.Fatalf("DeleteVersion: %s", err)
+	}
+}
+
+func TestDeleteVersionUnexpectedStatus(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer srv.Close()
+
+	client := &Client{HTTPClient: srv.Client(), BaseURL: srv.URL, Owner: "percona-platform", IsOrg: true}
+	if err := client.DeleteVersion(context.Background(), TypeContainer, "my-pkg", 42); err == nil {
+		t.Fatal("DeleteVersion returned nil error for a 404 response, want an error")
+	}
+}
@@ -0,0 +1,172 @@
+// Package retention implements the stale-packages retention policy: per
+// package, which versions are old enough, and not otherwise protected, to
+// be considered for deletion.
+package retention
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"time"
+
+	"github.com/percona-platform/get-stale-packages-action/pkg/semver"
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigPath is where the retention policy is expected to live in a repository.
+const ConfigPath = ".github/stale-packages.yml"
+
+// Duration wraps time.Duration so rules can spell it as "168h" in YAML
+// instead of a raw nanosecond count.
+type Duration time.Duration
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (d *Duration) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return fmt.Errorf("invalid duration %q: %w", s, err)
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// Rule is one entry of a Config, as loaded from YAML.
+type Rule struct {
+	// Packages is a path.Match glob matched against a package's name.
+	Packages string `yaml:"packages"`
+	// TTL is how long a version may go without a file update before it's stale.
+	TTL Duration `yaml:"ttl"`
+	// KeepLast always protects the N most recently updated versions, regardless of TTL.
+	KeepLast int `yaml:"keep_last"`
+	// ProtectTags is a list of regexps; a matching tag is never deleted.
+	ProtectTags []string `yaml:"protect_tags"`
+	// DeleteTags is a list of regexps; a matching tag is eligible for TTL
+	// expiry even if keep_last would otherwise protect it.
+	DeleteTags []string `yaml:"delete_tags"`
+}
+
+// CompiledRule is a Rule with its regex lists parsed, ready to classify tags.
+type CompiledRule struct {
+	Rule Rule
+
+	protectTags []*regexp.Regexp
+	deleteTags  []*regexp.Regexp
+}
+
+// TTL is how long a version may go without a file update before it's stale.
+func (r *CompiledRule) TTL() time.Duration { return time.Duration(r.Rule.TTL) }
+
+// KeepLast is how many of the most recently updated versions are always protected.
+func (r *CompiledRule) KeepLast() int { return r.Rule.KeepLast }
+
+// Protects reports whether tag is covered by this rule's protect_tags.
+func (r *CompiledRule) Protects(tag string) bool {
+	return matchesAny(r.protectTags, tag)
+}
+
+// ForcesDelete reports whether tag is covered by this rule's delete_tags.
+func (r *CompiledRule) ForcesDelete(tag string) bool {
+	return matchesAny(r.deleteTags, tag)
+}
+
+func matchesAny(patterns []*regexp.Regexp, s string) bool {
+	for _, re := range patterns {
+		if re.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
+
+// Config is the parsed .github/stale-packages.yml retention policy. Rules
+// are matched in order; the first whose Packages glob matches a package
+// name applies to it.
+type Config struct {
+	Rules []Rule `yaml:"rules"`
+
+	compiled []CompiledRule
+}
+
+// DefaultConfig is the policy applied when no config file is present. It
+// reproduces the action's original hardcoded behavior: every package's
+// versions expire after 7 days, except semver, 'latest' and
+// 'docker-base-layer' tags, which are never deleted.
+func DefaultConfig() *Config {
+	cfg := &Config{
+		Rules: []Rule{{
+			Packages: "*",
+			TTL:      Duration(7 * 24 * time.Hour),
+			ProtectTags: []string{
+				semver.Regexp.String(),
+				`^latest$`,
+				`^docker-base-layer$`,
+			},
+		}},
+	}
+	if err := cfg.compile(); err != nil {
+		// DefaultConfig's patterns are ours, not user input; a failure here is a bug.
+		panic(err)
+	}
+	return cfg
+}
+
+// Load reads and parses the retention policy at path. A missing file is not
+// an error: it yields DefaultConfig, so repositories that haven't adopted
+// one yet keep today's behavior.
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return DefaultConfig(), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var cfg Config
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	if err := cfg.compile(); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return &cfg, nil
+}
+
+func (c *Config) compile() error {
+	c.compiled = make([]CompiledRule, len(c.Rules))
+	for i, rule := range c.Rules {
+		cr := CompiledRule{Rule: rule}
+		for _, pattern := range rule.ProtectTags {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return fmt.Errorf("protect_tags %q: %w", pattern, err)
+			}
+			cr.protectTags = append(cr.protectTags, re)
+		}
+		for _, pattern := range rule.DeleteTags {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return fmt.Errorf("delete_tags %q: %w", pattern, err)
+			}
+			cr.deleteTags = append(cr.deleteTags, re)
+		}
+		c.compiled[i] = cr
+	}
+	return nil
+}
+
+// RuleFor returns the first rule whose Packages glob matches packageName, or
+// nil if none does.
+func (c *Config) RuleFor(packageName string) *CompiledRule {
+	for i := range c.compiled {
+		if ok, _ := path.Match(c.compiled[i].Rule.Packages, packageName); ok {
+			return &c.compiled[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package retention
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDefaultConfigProtectsSemverAndLatest(t *testing.T) {
+	cfg := DefaultConfig()
+	rule := cfg.RuleFor("any-package")
+	if rule == nil {
+		t.Fatal("RuleFor(\"any-package\") = nil, want the catch-all rule")
+	}
+	if got, want := rule.TTL(), 7*24*time.Hour; got != want {
+		t.Errorf("TTL() = %s, want %s", got, want)
+	}
+
+	for _, tag := range []string{"1.2.3", "latest", "docker-base-layer"} {
+		if !rule.Protects(tag) {
+			t.Errorf("Protects(%q) = false, want true", tag)
+		}
+	}
+	if rule.Protects("sha-abc1234") {
+		t.Error(`Protects("sha-abc1234") = true, want false`)
+	}
+}
+
+func TestRuleForMatchesFirstGlob(t *testing.T) {
+	cfg := &Config{
+		Rules: []Rule{
+			{Packages: "my-app-*", KeepLast: 3},
+			{Packages: "*", KeepLast: 1},
+		},
+	}
+	if err := cfg.compile(); err != nil {
+		t.Fatalf("compile: %s", err)
+	}
+
+	rule := cfg.RuleFor("my-app-server")
+	if rule == nil || rule.KeepLast() != 3 {
+		t.Fatalf("RuleFor(\"my-app-server\") = %+v, want the my-app-* rule", rule)
+	}
+
+	rule = cfg.RuleFor("other-package")
+	if rule == nil || rule.KeepLast() != 1 {
+		t.Fatalf("RuleFor(\"other-package\") = %+v, want the catch-all rule", rule)
+	}
+}
+
+func TestRuleForNoMatch(t *testing.T) {
+	cfg := &Config{Rules: []Rule{{Packages: "my-app-*"}}}
+	if err := cfg.compile(); err != nil {
+		t.Fatalf("compile: %s", err)
+	}
+	if rule := cfg.RuleFor("unrelated"); rule != nil {
+		t.Errorf("RuleFor(\"unrelated\") = %+v, want nil", rule)
+	}
+}
+
+func TestForcesDelete(t *testing.T) {
+	cfg := &Config{Rules: []Rule{{
+		Packages:   "*",
+		KeepLast:   5,
+		DeleteTags: []string{`^nightly-`},
+	}}}
+	if err := cfg.compile(); err != nil {
+		t.Fatalf("compile: %s", err)
+	}
+
+	rule := cfg.RuleFor("any")
+	if !rule.ForcesDelete("nightly-2024-01-01") {
+		t.Error(`ForcesDelete("nightly-2024-01-01") = false, want true`)
+	}
+	if rule.ForcesDelete("v1.2.3") {
+		t.Error(`ForcesDelete("v1.2.3") = true, want false`)
+	}
+}
+
+func TestDurationUnmarshalYAML(t *testing.T) {
+	var d Duration
+	err := d.UnmarshalYAML(func(v interface{}) error {
+		*v.(*string) = "168h"
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("UnmarshalYAML: %s", err)
+	}
+	if got, want := time.Duration(d), 168*time.Hour; got != want {
+		t.Errorf("Duration = %s, want %s", got, want)
+	}
+}
+
+func TestLoadMissingFileYieldsDefault(t *testing.T) {
+	cfg, err := Load("does-not-exist.yml")
+	if err != nil {
+		t.Fatalf("Load: %s", err)
+	}
+	if cfg.RuleFor("any").TTL() != DefaultConfig().RuleFor("any").TTL() {
+		t.Error("Load of a missing file did not yield DefaultConfig")
+	}
+}
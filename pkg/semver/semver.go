@@ -0,0 +1,136 @@
+// Package semver parses semantic version tags and orders them by semver.org
+// precedence, including prerelease ordering, so the retention policy can
+// reason about "the N highest releases of major version 2" instead of just
+// "does this look like semver".
+package semver
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// https://semver.org/#is-there-a-suggested-regular-expression-regex-to-check-a-semver-string
+const regExp = "^(?P<major>0|[1-9]\\d*)\\.(?P<minor>0|[1-9]\\d*)\\.(?P<patch>0|[1-9]\\d*)(?:-(?P<prerelease>" +
+	"(?:0|[1-9]\\d*|\\d*[a-zA-Z-][0-9a-zA-Z-]*)(?:\\.(?:0|[1-9]\\d*|\\d*[a-zA-Z-][0-9a-zA-Z-]*))*))?(?:\\+" +
+	"(?P<buildmetadata>[0-9a-zA-Z-]+(?:\\.[0-9a-zA-Z-]+)*))?$"
+
+// Regexp is the https://semver.org suggested pattern.
+var Regexp = regexp.MustCompile(regExp)
+
+// SemVer is a parsed semantic version.
+type SemVer struct {
+	Major, Minor, Patch int
+	Prerelease          string
+	Build               string
+}
+
+// Parse parses version as a semantic version. ok is false if version isn't
+// valid semver.
+func Parse(version string) (sv SemVer, ok bool) {
+	m := Regexp.FindStringSubmatch(version)
+	if m == nil {
+		return SemVer{}, false
+	}
+
+	major, _ := strconv.Atoi(m[1])
+	minor, _ := strconv.Atoi(m[2])
+	patch, _ := strconv.Atoi(m[3])
+	return SemVer{
+		Major:      major,
+		Minor:      minor,
+		Patch:      patch,
+		Prerelease: m[4],
+		Build:      m[5],
+	}, true
+}
+
+// IsPrerelease reports whether v carries a prerelease component (e.g. the
+// "rc.1" in "1.2.3-rc.1").
+func (v SemVer) IsPrerelease() bool {
+	return v.Prerelease != ""
+}
+
+// Core returns "major.minor.patch", ignoring prerelease and build metadata,
+// so a prerelease can be matched against the stable release it leads up to.
+func (v SemVer) Core() string {
+	return fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+}
+
+// Less reports whether v has lower semver precedence than other, following
+// semver.org's precedence rules: major, minor and patch are compared
+// numerically, a version without a prerelease outranks one with, and
+// prerelease identifiers are compared one dot-separated field at a time.
+// Build metadata never affects precedence.
+func (v SemVer) Less(other SemVer) bool {
+	return v.compare(other) < 0
+}
+
+func (v SemVer) compare(other SemVer) int {
+	if v.Major != other.Major {
+		return cmpInt(v.Major, other.Major)
+	}
+	if v.Minor != other.Minor {
+		return cmpInt(v.Minor, other.Minor)
+	}
+	if v.Patch != other.Patch {
+		return cmpInt(v.Patch, other.Patch)
+	}
+	return comparePrerelease(v.Prerelease, other.Prerelease)
+}
+
+// comparePrerelease implements semver.org's prerelease precedence rules.
+func comparePrerelease(a, b string) int {
+	if a == b {
+		return 0
+	}
+	// No prerelease outranks any prerelease.
+	if a == "" {
+		return 1
+	}
+	if b == "" {
+		return -1
+	}
+
+	aFields := strings.Split(a, ".")
+	bFields := strings.Split(b, ".")
+	for i := 0; i < len(aFields) && i < len(bFields); i++ {
+		if aFields[i] == bFields[i] {
+			continue
+		}
+
+		aNum, aIsNum := asNumber(aFields[i])
+		bNum, bIsNum := asNumber(bFields[i])
+		switch {
+		case aIsNum && bIsNum:
+			return cmpInt(aNum, bNum)
+		case aIsNum: // numeric identifiers always have lower precedence than alphanumeric ones
+			return -1
+		case bIsNum:
+			return 1
+		default:
+			return strings.Compare(aFields[i], bFields[i])
+		}
+	}
+	return cmpInt(len(aFields), len(bFields))
+}
+
+func asNumber(s string) (int, bool) {
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, false
+	}
+	return n, true
+}
+
+func cmpInt(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,72 @@
+package semver
+
+import "testing"
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		version string
+		wantOK  bool
+		want    SemVer
+	}{
+		{"1.2.3", true, SemVer{Major: 1, Minor: 2, Patch: 3}},
+		{"1.2.3-rc.1", true, SemVer{Major: 1, Minor: 2, Patch: 3, Prerelease: "rc.1"}},
+		{"1.2.3+build.5", true, SemVer{Major: 1, Minor: 2, Patch: 3, Build: "build.5"}},
+		{"latest", false, SemVer{}},
+		{"v1.2.3", false, SemVer{}},
+	}
+
+	for _, tt := range tests {
+		got, ok := Parse(tt.version)
+		if ok != tt.wantOK {
+			t.Errorf("Parse(%q) ok = %v, want %v", tt.version, ok, tt.wantOK)
+			continue
+		}
+		if ok && got != tt.want {
+			t.Errorf("Parse(%q) = %+v, want %+v", tt.version, got, tt.want)
+		}
+	}
+}
+
+func TestSemVerLess(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"1.0.0", "2.0.0", true},
+		{"2.0.0", "1.0.0", false},
+		{"1.2.0", "1.10.0", true},
+		{"1.2.3-alpha", "1.2.3", true},
+		{"1.2.3", "1.2.3-alpha", false},
+		{"1.2.3-alpha", "1.2.3-alpha.1", true},
+		{"1.2.3-alpha.1", "1.2.3-alpha.beta", true},
+		{"1.2.3-alpha.beta", "1.2.3-beta", true},
+		{"1.2.3-rc.1", "1.2.3-rc.2", true},
+	}
+
+	for _, tt := range tests {
+		a, ok := Parse(tt.a)
+		if !ok {
+			t.Fatalf("Parse(%q) failed", tt.a)
+		}
+		b, ok := Parse(tt.b)
+		if !ok {
+			t.Fatalf("Parse(%q) failed", tt.b)
+		}
+		if got := a.Less(b); got != tt.want {
+			t.Errorf("%q.Less(%q) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestCore(t *testing.T) {
+	sv, ok := Parse("1.2.3-rc.1+build.5")
+	if !ok {
+		t.Fatal("Parse failed")
+	}
+	if got, want := sv.Core(), "1.2.3"; got != want {
+		t.Errorf("Core() = %q, want %q", got, want)
+	}
+	if !sv.IsPrerelease() {
+		t.Error("IsPrerelease() = false, want true")
+	}
+}
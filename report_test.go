@@ -0,0 +1,251 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/percona-platform/get-stale-packages-action/pkg/retention"
+	"github.com/percona-platform/get-stale-packages-action/pkg/semver"
+	"github.com/shurcooL/githubv4"
+)
+
+func loadTestConfig(t *testing.T, yaml string) *retention.Config {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "stale-packages.yml")
+	if err := os.WriteFile(path, []byte(yaml), 0o644); err != nil {
+		t.Fatalf("WriteFile: %s", err)
+	}
+	cfg, err := retention.Load(path)
+	if err != nil {
+		t.Fatalf("retention.Load: %s", err)
+	}
+	return cfg
+}
+
+func mustParseSemVer(t *testing.T, version string) semver.SemVer {
+	t.Helper()
+	sv, ok := semver.Parse(version)
+	if !ok {
+		t.Fatalf("semver.Parse(%q) failed", version)
+	}
+	return sv
+}
+
+func TestClassifyVersionLiveProtectionWins(t *testing.T) {
+	live := newLivePRRefs()
+	live.add(4, "", "")
+	rule := retention.DefaultConfig().RuleFor("any")
+
+	if got := classifyVersion("pr-4", live, rule, false, semverState{}); got != Protected {
+		t.Errorf("classifyVersion() = %v, want Protected", got)
+	}
+}
+
+func TestClassifyVersionProtectTagsBeatsSemverHeuristics(t *testing.T) {
+	cfg := loadTestConfig(t, `
+rules:
+  - packages: "*"
+    ttl: 168h
+    protect_tags:
+      - "^1\\.0\\.0-rc\\.1$"
+`)
+	rule := cfg.RuleFor("any")
+
+	sv := semverState{
+		keepPerMajor: 1,
+		kept:         map[string]bool{}, // "1.0.0-rc.1" is not among the kept releases
+		stableCores:  map[string]bool{"1.0.0": true},
+	}
+
+	// Without the protect_tags check running first, this would fall through
+	// to the prerelease-expiry rule (a stable 1.0.0 exists) and come back Stale.
+	if got := classifyVersion("1.0.0-rc.1", nil, rule, false, sv); got != Skip {
+		t.Errorf("classifyVersion() = %v, want Skip (protected by protect_tags)", got)
+	}
+}
+
+func TestClassifyVersionPrereleaseExpiresOnceStableExists(t *testing.T) {
+	cfg := loadTestConfig(t, "rules:\n  - packages: \"*\"\n    ttl: 168h\n")
+	rule := cfg.RuleFor("any")
+	sv := semverState{stableCores: map[string]bool{"1.0.0": true}}
+
+	if got := classifyVersion("1.0.0-rc.1", nil, rule, false, sv); got != Stale {
+		t.Errorf("classifyVersion() = %v, want Stale", got)
+	}
+}
+
+func TestClassifyVersionKeepPerMajor(t *testing.T) {
+	cfg := loadTestConfig(t, "rules:\n  - packages: \"*\"\n    ttl: 168h\n")
+	rule := cfg.RuleFor("any")
+	sv := semverState{keepPerMajor: 1, kept: map[string]bool{"2.1.0": true}}
+
+	if got := classifyVersion("2.1.0", nil, rule, false, sv); got != Protected {
+		t.Errorf("classifyVersion(kept release) = %v, want Protected", got)
+	}
+	if got := classifyVersion("2.0.0", nil, rule, false, sv); got != Stale {
+		t.Errorf("classifyVersion(non-kept release) = %v, want Stale", got)
+	}
+}
+
+func TestClassifyVersionKeepLastAndForcesDelete(t *testing.T) {
+	cfg := loadTestConfig(t, `
+rules:
+  - packages: "*"
+    ttl: 168h
+    keep_last: 2
+    delete_tags:
+      - "^nightly-"
+`)
+	rule := cfg.RuleFor("any")
+
+	if got := classifyVersion("sha-abc1234", nil, rule, true, semverState{}); got != Protected {
+		t.Errorf("classifyVersion(recent, not forced) = %v, want Protected", got)
+	}
+	if got := classifyVersion("nightly-2024-01-01", nil, rule, true, semverState{}); got != Stale {
+		t.Errorf("classifyVersion(recent, forced delete) = %v, want Stale", got)
+	}
+	if got := classifyVersion("sha-abc1234", nil, rule, false, semverState{}); got != Stale {
+		t.Errorf("classifyVersion(not recent) = %v, want Stale", got)
+	}
+}
+
+func TestComputeSemverState(t *testing.T) {
+	versions := []versionNode{
+		{Version: githubv4.String("1.0.0")},
+		{Version: githubv4.String("1.1.0")},
+		{Version: githubv4.String("2.0.0")},
+		{Version: githubv4.String("2.0.0-rc.1")},
+		{Version: githubv4.String("not-semver")},
+	}
+
+	sv := computeSemverState(versions, 1)
+
+	if !sv.kept["1.1.0"] {
+		t.Error(`kept["1.1.0"] = false, want true (highest major 1 release)`)
+	}
+	if sv.kept["1.0.0"] {
+		t.Error(`kept["1.0.0"] = true, want false`)
+	}
+	if !sv.kept["2.0.0"] {
+		t.Error(`kept["2.0.0"] = false, want true (stable outranks its own prerelease)`)
+	}
+	if sv.kept["2.0.0-rc.1"] {
+		t.Error(`kept["2.0.0-rc.1"] = true, want false`)
+	}
+	if !sv.hasStableRelease(mustParseSemVer(t, "2.0.0-rc.1")) {
+		t.Error("hasStableRelease(2.0.0-rc.1) = false, want true")
+	}
+}
+
+func newTestVersionNode(id string, databaseID int, tag string, updatedAt time.Time, size int64) versionNode {
+	return versionNode{
+		ID:         id,
+		DatabaseID: githubv4.Int(databaseID),
+		Version:    githubv4.String(tag),
+		Files: struct {
+			Nodes []struct {
+				UpdatedAt githubv4.DateTime
+				Size      githubv4.Int
+			}
+		}{
+			Nodes: []struct {
+				UpdatedAt githubv4.DateTime
+				Size      githubv4.Int
+			}{{UpdatedAt: githubv4.DateTime{Time: updatedAt}, Size: githubv4.Int(size)}},
+		},
+	}
+}
+
+func TestScanPackagesWorkerPool(t *testing.T) {
+	cfg := retention.DefaultConfig()
+	old := time.Now().Add(-30 * 24 * time.Hour)
+
+	versionsField := func(nodes []versionNode, hasNext bool, cursor githubv4.String) struct {
+		Nodes    []versionNode
+		PageInfo PageInfo
+	} {
+		return struct {
+			Nodes    []versionNode
+			PageInfo PageInfo
+		}{Nodes: nodes, PageInfo: PageInfo{HasNextPage: hasNext, EndCursor: cursor}}
+	}
+
+	pkgs := []packageNode{
+		{
+			Name:        "pkg-a",
+			PackageType: "DOCKER",
+			Versions:    versionsField([]versionNode{newTestVersionNode("a1", 1, "sha-aaaaaaa", old, 100)}, true, "cursor-a"),
+		},
+		{
+			Name:        "pkg-b",
+			PackageType: "DOCKER",
+			Versions:    versionsField([]versionNode{newTestVersionNode("b1", 2, "sha-bbbbbbb", old, 200)}, false, ""),
+		},
+	}
+
+	fetchMore := func(ctx context.Context, pkgName string, cursor githubv4.String) []versionNode {
+		if pkgName != "pkg-a" || cursor != "cursor-a" {
+			t.Errorf("fetchMore(%q, %q), want (\"pkg-a\", \"cursor-a\")", pkgName, cursor)
+		}
+		return []versionNode{newTestVersionNode("a2", 3, "sha-ccccccc", old, 300)}
+	}
+
+	records, report := scanPackages(context.Background(), pkgs, 2, fetchMore, nil, cfg, 0)
+
+	if len(records) != 3 {
+		t.Fatalf("len(records) = %d, want 3", len(records))
+	}
+	if len(report) != 3 {
+		t.Fatalf("len(report) = %d, want 3", len(report))
+	}
+	for _, entry := range report {
+		if entry.Classification != "stale" {
+			t.Errorf("report entry %+v classification = %q, want %q", entry, entry.Classification, "stale")
+		}
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	tests := []struct {
+		n    int64
+		want string
+	}{
+		{0, "0 B"},
+		{512, "512 B"},
+		{1024, "1.0 KiB"},
+		{1536, "1.5 KiB"},
+		{1024 * 1024, "1.0 MiB"},
+	}
+	for _, tt := range tests {
+		if got := formatBytes(tt.n); got != tt.want {
+			t.Errorf("formatBytes(%d) = %q, want %q", tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestWriteJobSummary(t *testing.T) {
+	summaryPath := filepath.Join(t.TempDir(), "summary.md")
+	t.Setenv("GITHUB_STEP_SUMMARY", summaryPath)
+
+	writeJobSummary([]reportEntry{
+		{PackageName: "pkg-a", Classification: "stale", SizeBytes: 1024},
+		{PackageName: "pkg-a", Classification: "protected"},
+		{PackageName: "pkg-b", Classification: "skipped"},
+	})
+
+	data, err := os.ReadFile(summaryPath)
+	if err != nil {
+		t.Fatalf("ReadFile: %s", err)
+	}
+
+	got := string(data)
+	for _, want := range []string{"pkg-a", "pkg-b", "1.0 KiB", "Total"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("job summary = %q, missing %q", got, want)
+		}
+	}
+}